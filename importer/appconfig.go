@@ -8,8 +8,23 @@ import (
 
 // AppConfig contains the command-line options chosen by the user
 type AppConfig struct {
-	DatabaseName string
-	Concurrency  int
+	DatabaseName     string
+	Concurrency      int
+	MaxConcurrency   int    // ceiling the adaptive controller may grow Concurrency to
+	MinBatchSize     int    // floor the adaptive controller may shrink the batch size to
+	MaxBatchSize     int    // ceiling the adaptive controller may grow the batch size to, and the buffer's capacity
+	InputPath        string // path to the input file, or "-"/"" for stdin
+	Format           string // input format: ndjson, csv or json
+	CSVTypes         string // comma-separated col:type overrides for --format=csv, e.g. "age:int,active:bool"
+	IDField          string // dotted jsonpath of a field to promote to _id, e.g. "user.email"
+	IDStrategy       string // how to synthesize _id when --id-field is unset or missing from a document: uuid, hash or sequence
+	HashFields       string // comma-separated fields to hash for --id-strategy=hash; empty means hash every field
+	TransformPath    string // path to a --transform hook invoked between parsing and buffering
+	Progress         bool   // render a live progress bar on stderr instead of a per-batch log line
+	Total            int64  // expected total document count, for the progress bar's ETA; 0 if unknown
+	LogFormat        string // per-batch log line format: text or json
+	CheckpointPath   string // path to a checkpoint file used to resume an interrupted import
+	FailedOutputPath string // path to an NDJSON dead-letter file for documents Cloudant rejected, e.g. on conflict
 }
 
 func (ac AppConfig) Print() {
@@ -17,6 +32,21 @@ func (ac AppConfig) Print() {
 	fmt.Println("----------")
 	fmt.Printf("DatabaseName: %v\n", ac.DatabaseName)
 	fmt.Printf("Concurrency: %v\n", ac.Concurrency)
+	fmt.Printf("MaxConcurrency: %v\n", ac.MaxConcurrency)
+	fmt.Printf("MinBatchSize: %v\n", ac.MinBatchSize)
+	fmt.Printf("MaxBatchSize: %v\n", ac.MaxBatchSize)
+	fmt.Printf("InputPath: %v\n", ac.InputPath)
+	fmt.Printf("Format: %v\n", ac.Format)
+	fmt.Printf("CSVTypes: %v\n", ac.CSVTypes)
+	fmt.Printf("IDField: %v\n", ac.IDField)
+	fmt.Printf("IDStrategy: %v\n", ac.IDStrategy)
+	fmt.Printf("HashFields: %v\n", ac.HashFields)
+	fmt.Printf("TransformPath: %v\n", ac.TransformPath)
+	fmt.Printf("Progress: %v\n", ac.Progress)
+	fmt.Printf("Total: %v\n", ac.Total)
+	fmt.Printf("LogFormat: %v\n", ac.LogFormat)
+	fmt.Printf("CheckpointPath: %v\n", ac.CheckpointPath)
+	fmt.Printf("FailedOutputPath: %v\n", ac.FailedOutputPath)
 }
 
 func NewAppConfig() (*AppConfig, error) {
@@ -25,15 +55,40 @@ func NewAppConfig() (*AppConfig, error) {
 	// parse command-line options
 	flag.StringVar(&appConfig.DatabaseName, "dbname", "", "The Cloudant database name to write to")
 	flag.StringVar(&appConfig.DatabaseName, "db", "", "The Cloudant database name to write to")
-	flag.IntVar(&appConfig.Concurrency, "concurrency", 1, "The number of concurrent HTTP write requests in flight")
-	flag.IntVar(&appConfig.Concurrency, "c", 1, "The number of concurrent HTTP write requests in flight")
+	flag.IntVar(&appConfig.Concurrency, "concurrency", 1, "The starting number of concurrent HTTP write requests in flight")
+	flag.IntVar(&appConfig.Concurrency, "c", 1, "The starting number of concurrent HTTP write requests in flight")
+	flag.IntVar(&appConfig.MaxConcurrency, "max-concurrency", 20, "The ceiling the adaptive controller may grow concurrency to")
+	flag.IntVar(&appConfig.MinBatchSize, "min-batch", 50, "The floor the adaptive controller may shrink the batch size to")
+	flag.IntVar(&appConfig.MaxBatchSize, "max-batch", 500, "The ceiling the adaptive controller may grow the batch size to")
+	flag.StringVar(&appConfig.InputPath, "input", "-", "Path to the input file, or - to read from stdin. Gzip-compressed input is detected automatically")
+	flag.StringVar(&appConfig.Format, "format", "ndjson", "The input format: ndjson, csv or json")
+	flag.StringVar(&appConfig.CSVTypes, "csv-types", "", "Comma-separated col:type overrides for --format=csv, e.g. \"age:int,active:bool\"")
+	flag.StringVar(&appConfig.IDField, "id-field", "", "Dotted jsonpath of a field to promote to _id, e.g. \"user.email\"")
+	flag.StringVar(&appConfig.IDStrategy, "id-strategy", "", "How to synthesize _id when --id-field is unset or missing from a document: uuid, hash or sequence")
+	flag.StringVar(&appConfig.HashFields, "hash-fields", "", "Comma-separated fields to hash for --id-strategy=hash; defaults to every field in the document")
+	flag.StringVar(&appConfig.TransformPath, "transform", "", "Path to a compiled Go plugin (.so) exporting a Transform hook, invoked on each document before buffering")
+	flag.BoolVar(&appConfig.Progress, "progress", false, "Render a live progress bar on stderr instead of a per-batch log line")
+	flag.Int64Var(&appConfig.Total, "total", 0, "Expected total document count, used for the --progress bar's ETA")
+	flag.StringVar(&appConfig.LogFormat, "log-format", "text", "Per-batch log line format: text or json")
+	flag.StringVar(&appConfig.CheckpointPath, "checkpoint", "", "Path to a checkpoint file used to resume an interrupted import")
+	flag.StringVar(&appConfig.FailedOutputPath, "failed-output", "", "Path to an NDJSON dead-letter file that documents rejected by Cloudant (e.g. on conflict) are appended to, for inspection and re-import")
 	flag.Parse()
 
 	// if we don't have a database name after parsing
 	if appConfig.DatabaseName == "" {
 		return nil, errors.New("missing dbname/db")
+	} else if appConfig.Format != "ndjson" && appConfig.Format != "csv" && appConfig.Format != "json" {
+		return nil, errors.New("format must be one of ndjson, csv or json")
+	} else if appConfig.IDStrategy != "" && appConfig.IDStrategy != "uuid" && appConfig.IDStrategy != "hash" && appConfig.IDStrategy != "sequence" {
+		return nil, errors.New("id-strategy must be one of uuid, hash or sequence")
+	} else if appConfig.LogFormat != "text" && appConfig.LogFormat != "json" {
+		return nil, errors.New("log-format must be text or json")
 	} else if appConfig.Concurrency < 1 || appConfig.Concurrency > 50 {
 		return nil, errors.New("conccurrency must be between 1 and 50")
+	} else if appConfig.MaxConcurrency < appConfig.Concurrency || appConfig.MaxConcurrency > 50 {
+		return nil, errors.New("max-concurrency must be between concurrency and 50")
+	} else if appConfig.MinBatchSize < 1 || appConfig.MinBatchSize > appConfig.MaxBatchSize {
+		return nil, errors.New("min-batch must be between 1 and max-batch")
 	} else {
 		return &appConfig, nil
 	}
@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// resumePoint is the byte-offset/doc-count coordinates a --checkpoint file
+// would record if the import resumed right after a specific batch, before
+// that batch's stats are folded in. CloudantImport only persists one once
+// a batch it belongs to is confirmed written - see confirmBatch.
+type resumePoint struct {
+	Offset   int64
+	DocCount int64
+}
+
+// checkpointState is the JSON-serializable snapshot of import progress
+// written to the --checkpoint file. It lets a crashed or interrupted import
+// be resumed without re-writing documents that were already handed off to
+// Cloudant in an earlier run; a resume by byte offset also skips re-reading
+// them, while a resume by DocCount reads past them and discards them.
+type checkpointState struct {
+	Offset   int64         `json:"offset"`   // byte offset into a seekable, uncompressed ndjson --input file
+	DocCount int64         `json:"docCount"` // documents already consumed, for formats/inputs that can't resume by byte offset
+	Stats    statsSnapshot `json:"stats"`    // cumulative stats carried forward from prior runs
+}
+
+// loadCheckpoint reads a checkpointState from path. It returns a nil state
+// and a nil error if path is empty or the file doesn't exist yet, since that
+// is the normal case for the first run of an import.
+func loadCheckpoint(path string) (*checkpointState, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveCheckpoint persists state to path, replacing any previous checkpoint.
+// It writes to a temporary file and renames it into place so a crash during
+// the write can never leave behind a truncated, unreadable checkpoint.
+func saveCheckpoint(path string, state checkpointState) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
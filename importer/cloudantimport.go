@@ -2,31 +2,66 @@ package importer
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/IBM/cloudant-go-sdk/cloudantv1"
 )
 
-const bufferSize = 500 // the maximum size of our internal buffer of unwritten documents
-
 type CloudantImport struct {
-	appConfig   *AppConfig                 // our command-line options
-	buffer      []cloudantv1.Document      // the buffer of documents that haven't been saved to Cloudant yet
-	service     *cloudantv1.CloudantV1     // the Cloudant SDK client
-	bufferLen   int                        // how many strings are in our buffer
-	reader      *bufio.Reader              // the input stream
-	stats       *Stats                     // running statistics
-	wgWorker    sync.WaitGroup             // to keep track of running goroutines
-	wgCollector sync.WaitGroup             // to keep track of the collector goroutine
-	resultsChan chan StatsDataPoint        // channel to carry results of API calls
-	jobsChan    chan []cloudantv1.Document // channel to carry jobs, slices of Cloudant documents to write
-	errorsChan  chan error                 // channel to carry errors that occurred when writing to Cloudant
+	appConfig   *AppConfig               // our command-line options
+	buffer      []cloudantv1.Document    // the buffer of documents that haven't been saved to Cloudant yet, sized to the max batch size
+	originals   []map[string]interface{} // the pre-conversion form of buffer, parallel by index, for dead-lettering failed documents
+	service     *cloudantv1.CloudantV1   // the Cloudant SDK client
+	bufferLen   int                      // how many documents are in our buffer
+	inputFile   *os.File                 // the input file, or os.Stdin
+	source      Source                   // yields parsed documents, independent of --format
+	idAssigner  *idAssigner              // promotes/synthesizes _id per --id-field and --id-strategy
+	transform   TransformFunc            // --transform hook, or nil if none was configured
+	deadLetter  *deadLetterWriter        // --failed-output writer, or nil if not enabled
+	stats       *Stats                   // running statistics
+	progress    *progressReporter        // --progress bar, or nil if not enabled
+	controller  *rateController          // adaptive concurrency/batch-size controller, driven by 429/503 feedback
+	wgWorker    sync.WaitGroup           // to keep track of running goroutines
+	wgCollector sync.WaitGroup           // to keep track of the collector goroutine
+	resultsChan chan StatsDataPoint      // channel to carry results of API calls
+	ctx         context.Context          // cancelled by fail() once a worker hits an unrecoverable error
+	cancel      context.CancelFunc
+	fatalOnce   sync.Once // guards fatalErr so only the first unrecoverable error wins
+	fatalErr    error     // set by fail(); if non-nil once the workers drain, Run returns it
+
+	byteOffsetResume bool  // whether bytesRead is tracked via the source's own BytesRead() rather than via skipDocs
+	byteOffsetBase   int64 // the file offset the source started reading from, if resuming; added to its BytesRead()
+	bytesRead        int64 // bytes consumed from inputFile so far, for checkpointing a byte-offset resume
+	docCount         int64 // documents yielded by source so far, for checkpointing a resume-by-skip
+	skipDocs         int64 // documents still to be skipped to reach a resume-by-skip checkpoint's resume point
+
+	// checkpointMu guards the fields below. They track, per dispatched
+	// batch, the resume point that batch would advance the checkpoint to
+	// once its outcome is known - see registerDispatch and confirmBatch.
+	checkpointMu        sync.Mutex
+	nextBatchSeq        int64                 // sequence number the next dispatched batch will be assigned, in dispatch order
+	pendingResumePoints map[int64]resumePoint // seq -> resume point if/when that batch confirms
+	confirmedSeqs       map[int64]bool        // seq -> batch outcome resolved (written, dead-lettered, or otherwise accounted for)
+	lastConfirmedSeq    int64                 // highest seq confirmed in an unbroken run from 0
+	lastConfirmedPoint  resumePoint           // the resume point as of lastConfirmedSeq; what checkpoint() persists
+}
+
+// byteCounter is implemented by a Source that can report how many input
+// bytes it has actually consumed - counted as lines are parsed, not as the
+// bufio.Reader beneath it refills its read-ahead buffer - so a byte-offset
+// checkpoint reflects what's truly been handed off rather than what's
+// merely been prefetched. Only ndjsonSource implements it; byteOffsetResume
+// is only ever true for that format.
+type byteCounter interface {
+	BytesRead() int64
 }
 
 // New creates a new CloudantImport struct, loading the CLI parameters,
@@ -45,89 +80,301 @@ func New() (*CloudantImport, error) {
 	}
 	service.EnableRetries(3, 5*time.Second)
 
-	// setup the buffer
-	buffer := make([]cloudantv1.Document, bufferSize)
+	// setup the buffer, sized to the largest batch the controller may grow to
+	buffer := make([]cloudantv1.Document, appConfig.MaxBatchSize)
+	originals := make([]map[string]interface{}, appConfig.MaxBatchSize)
+
+	// setup the input file - a named, seekable file that can be resumed by
+	// byte offset, or stdin which can only be resumed by skipping documents
+	inputFile := os.Stdin
+	seekable := false
+	if appConfig.InputPath != "" && appConfig.InputPath != "-" {
+		inputFile, err = os.Open(appConfig.InputPath)
+		if err != nil {
+			return nil, err
+		}
+		seekable = true
+	}
+
+	// peek the leading bytes to see whether the input is gzip-compressed.
+	// Byte-offset resume can't safely seek into the middle of a gzip
+	// stream, so that combination falls back to resume-by-skip below.
+	fileReader := bufio.NewReader(inputFile)
+	magic, _ := fileReader.Peek(len(gzipMagic))
+	gzipped := len(magic) == len(gzipMagic) && magic[0] == gzipMagic[0] && magic[1] == gzipMagic[1]
+	byteOffsetResume := seekable && !gzipped && (appConfig.Format == "" || appConfig.Format == "ndjson")
+
+	// load the --transform hook, if one was configured
+	transform, err := loadTransform(appConfig.TransformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// build the reporter for each batch's LogLine, and a stats placeholder
+	// that feeds it
+	reporter, err := newReporter(appConfig.LogFormat, appConfig.Progress)
+	if err != nil {
+		return nil, err
+	}
+	stats := NewStats(reporter)
+
+	controller := newRateController(appConfig)
 
-	// setup IO reader
-	reader := bufio.NewReader(os.Stdin)
+	// load the --failed-output dead-letter writer, if one was configured
+	deadLetter, err := newDeadLetterWriter(appConfig.FailedOutputPath)
+	if err != nil {
+		return nil, err
+	}
 
-	// create a stats placeholder
-	stats := NewStats()
+	ctx, cancel := context.WithCancel(context.Background())
 
 	ci := CloudantImport{
 		appConfig:   appConfig,
 		buffer:      buffer,
+		originals:   originals,
 		service:     service,
 		bufferLen:   0,
-		reader:      reader,
+		inputFile:   inputFile,
+		idAssigner:  newIDAssigner(appConfig),
+		transform:   transform,
+		deadLetter:  deadLetter,
 		stats:       stats,
+		controller:  controller,
 		wgWorker:    sync.WaitGroup{},
 		wgCollector: sync.WaitGroup{},
 		resultsChan: make(chan StatsDataPoint),
-		jobsChan:    make(chan []cloudantv1.Document, appConfig.Concurrency),
-		errorsChan:  make(chan error),
+		ctx:         ctx,
+		cancel:      cancel,
+
+		byteOffsetResume: byteOffsetResume,
+
+		pendingResumePoints: make(map[int64]resumePoint),
+		confirmedSeqs:       make(map[int64]bool),
+		lastConfirmedSeq:    -1,
+	}
+	if appConfig.Progress {
+		ci.progress = newProgressReporter(stats, controller, appConfig.Total)
+	}
+
+	// resume from a previous checkpoint, if one exists
+	checkpoint, err := loadCheckpoint(appConfig.CheckpointPath)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != nil {
+		if byteOffsetResume {
+			if _, err := ci.inputFile.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			ci.byteOffsetBase = checkpoint.Offset
+			ci.bytesRead = checkpoint.Offset
+			fileReader = bufio.NewReader(ci.inputFile)
+		} else {
+			ci.skipDocs = checkpoint.DocCount
+			ci.docCount = checkpoint.DocCount
+		}
+		ci.stats.merge(checkpoint.Stats)
 	}
+	// everything up to here is already a known-good resume point, whether
+	// or not a checkpoint was actually loaded
+	ci.lastConfirmedPoint = resumePoint{Offset: ci.bytesRead, DocCount: ci.docCount}
+
+	source, err := newSource(appConfig.Format, fileReader, appConfig.CSVTypes)
+	if err != nil {
+		return nil, err
+	}
+	ci.source = source
 
 	return &ci, nil
 }
 
-// writeBuffer saves the stored Cloudant documents to Cloudant. It is a
-// goroutine, so there are N workers - 1 per "concurrency". Each work
-// loops on the jobsChan waiting to be sent batches of data.
-// When the channel is closed, the workers will exit. Response data is
-// transmitted back on the resultsChan, errors on the errorsChan.
-func (ci *CloudantImport) writeBufferWorker() {
-	// make sure we release our slot
+// dispatch hands a batch of buffered documents, and their pre-conversion
+// originals (for dead-lettering), off to a new writeBufferWorker goroutine.
+// Both slices are cloned because the caller goes on to reuse the underlying
+// buffers, which if left unshared would modify the data that the worker is
+// in the middle of sending. The batch is assigned a sequence number so its
+// resume point is only ever persisted once its outcome is confirmed - see
+// registerDispatch and confirmBatch.
+func (ci *CloudantImport) dispatch(batch []cloudantv1.Document, originals []map[string]interface{}) {
+	docsClone := make([]cloudantv1.Document, len(batch))
+	copy(docsClone, batch)
+	originalsClone := make([]map[string]interface{}, len(originals))
+	copy(originalsClone, originals)
+
+	seq := ci.registerDispatch()
+
+	ci.wgWorker.Add(1)
+	go ci.writeBufferWorker(seq, docsClone, originalsClone)
+}
+
+// registerDispatch assigns the next batch its sequence number and records
+// the resume point it would advance the checkpoint to once its outcome is
+// confirmed. It must be called synchronously from the read loop, before the
+// worker goroutine is spawned, so sequence numbers reflect dispatch order.
+func (ci *CloudantImport) registerDispatch() int64 {
+	ci.checkpointMu.Lock()
+	defer ci.checkpointMu.Unlock()
+	seq := ci.nextBatchSeq
+	ci.nextBatchSeq++
+	ci.pendingResumePoints[seq] = resumePoint{Offset: ci.bytesRead, DocCount: ci.docCount}
+	return seq
+}
+
+// confirmBatch marks a dispatched batch's outcome as resolved - written, or
+// dead-lettered after its retries were exhausted - and, if that closes a
+// gap in dispatch order, advances and persists the checkpoint to the resume
+// point of the latest batch now confirmed in an unbroken sequence from the
+// start. Batches can confirm out of order since they run concurrently, but
+// the checkpoint never jumps ahead of one still outstanding. A batch whose
+// outcome is never resolved - dropped because ctx was already cancelled, or
+// lost to fail() - simply never confirms, which correctly caps the
+// persisted checkpoint at the last batch that did, rather than one that
+// merely happened to finish first.
+func (ci *CloudantImport) confirmBatch(seq int64) {
+	ci.checkpointMu.Lock()
+	defer ci.checkpointMu.Unlock()
+
+	ci.confirmedSeqs[seq] = true
+	advanced := false
+	for ci.confirmedSeqs[ci.lastConfirmedSeq+1] {
+		ci.lastConfirmedSeq++
+		ci.lastConfirmedPoint = ci.pendingResumePoints[ci.lastConfirmedSeq]
+		delete(ci.pendingResumePoints, ci.lastConfirmedSeq)
+		delete(ci.confirmedSeqs, ci.lastConfirmedSeq)
+		advanced = true
+	}
+	if advanced {
+		ci.checkpoint(ci.lastConfirmedPoint)
+	}
+}
+
+// fail records the first unrecoverable error encountered by a worker and
+// cancels ctx, so Run's read loop stops buffering further batches and any
+// workers still retrying give up instead of continuing to hammer Cloudant.
+func (ci *CloudantImport) fail(err error) {
+	ci.fatalOnce.Do(func() {
+		ci.fatalErr = err
+		ci.cancel()
+	})
+}
+
+// writeBufferWorker sends a single batch of documents to Cloudant. It is
+// spawned as a goroutine per batch, and its concurrency is capped not by a
+// fixed worker pool but by ci.controller's resizable semaphore, which the
+// controller grows or shrinks in response to 429/503 feedback.
+//
+// A batch that fails with a retryable error - a timeout, a 429, or a 5xx -
+// is retried in place with exponential backoff and jitter, up to
+// maxBatchRetries times. If it's still retryable once that budget is
+// exhausted, the whole batch is dead-lettered (or, absent --failed-output,
+// fails the import) rather than being reported as a silent success. Any
+// other error is fatal: it's handed to fail(), which cancels ctx and causes
+// Run to return it once the worker pool has drained. Documents that come
+// back from an otherwise successful write with a per-document error (e.g.
+// a conflict) are appended to --failed-output via ci.deadLetter rather than
+// failing the batch.
+//
+// seq is this batch's dispatch sequence number; it's only fed to
+// confirmBatch once the batch's outcome is actually resolved (written, or
+// dead-lettered), so a batch dropped or lost to a fatal error never
+// advances the checkpoint past itself.
+func (ci *CloudantImport) writeBufferWorker(seq int64, job []cloudantv1.Document, originals []map[string]interface{}) {
 	defer ci.wgWorker.Done()
 
-	for job := range ci.jobsChan {
-		start := time.Now()
+	// wait for a concurrency slot, released when this batch is done
+	ci.controller.sem.acquire()
+	defer ci.controller.sem.release()
 
-		// write to Cloudant with POST /{db}/_bulk_docs
-		postBulkDocsOptions := ci.service.NewPostBulkDocsOptions(ci.appConfig.DatabaseName)
-		bulkDocs, err := ci.service.NewBulkDocs(job)
-		if err != nil {
-			ci.errorsChan <- err
+	if ci.ctx.Err() != nil {
+		return
+	}
+
+	concurrency, batchSize := ci.controller.Concurrency(), ci.controller.BatchSize()
+	start := time.Now()
+
+	// write to Cloudant with POST /{db}/_bulk_docs
+	postBulkDocsOptions := ci.service.NewPostBulkDocsOptions(ci.appConfig.DatabaseName)
+	bulkDocs, err := ci.service.NewBulkDocs(job)
+	if err != nil {
+		ci.fail(err)
+		return
+	}
+	postBulkDocsOptions.SetBulkDocs(bulkDocs)
+
+	for attempt := 0; ; attempt++ {
+		result, response, callErr := ci.service.PostBulkDocs(postBulkDocsOptions)
+		statusCode := 0
+		if response != nil {
+			statusCode = response.StatusCode
+		}
+		retryable := isRetryableErr(callErr) || isRetryableStatus(statusCode)
+
+		if retryable && attempt < maxBatchRetries {
+			time.Sleep(retryDelay(attempt))
+			continue
+		}
+		if callErr != nil {
+			ci.fail(callErr)
 			return
 		}
-		postBulkDocsOptions.SetBulkDocs(bulkDocs)
-		result, response, err := ci.service.PostBulkDocs(postBulkDocsOptions)
-		if err != nil {
-			ci.errorsChan <- err
+
+		if retryable {
+			// maxBatchRetries exhausted but Cloudant is still unhappy
+			// (429/503/5xx); result is almost certainly empty for a
+			// request-level error like this, so there's nothing for the
+			// per-document handling below to dead-letter or count as
+			// written. Dead-letter the whole batch instead of letting it
+			// fall through and silently report as a success, or fail the
+			// import outright if there's nowhere to send the dead letters.
+			reason := fmt.Sprintf("batch write failed after %d attempts: HTTP %d", maxBatchRetries+1, statusCode)
+			if ci.deadLetter == nil {
+				ci.fail(errors.New(reason))
+				return
+			}
+			for _, original := range originals {
+				ci.deadLetter.Write(original, reason)
+			}
+			ci.controller.onResult(statusCode)
+			ci.confirmBatch(seq)
 			return
 		}
+
 		latency := time.Since(start)
 
-		// save the stats
-		statsDataPoint := StatsDataPoint{
-			statusCode: response.StatusCode,
-			result:     result,
-			latency:    int(latency.Milliseconds()),
+		// fold the outcome into the rate controller, and back off before
+		// releasing our slot if Cloudant asked us to slow down
+		if backoff := ci.controller.onResult(statusCode); backoff > 0 {
+			time.Sleep(backoff)
+		}
+
+		// dead-letter any document that came back with its own error,
+		// e.g. a conflict, rather than failing the whole batch over it
+		if ci.deadLetter != nil {
+			for i, docResult := range result {
+				if docResult.Error != nil && i < len(originals) {
+					ci.deadLetter.Write(originals[i], *docResult.Error)
+				}
+			}
+		}
+
+		ci.resultsChan <- StatsDataPoint{
+			statusCode:  statusCode,
+			result:      result,
+			latency:     int(latency.Milliseconds()),
+			concurrency: concurrency,
+			batchSize:   batchSize,
 		}
-		ci.resultsChan <- statsDataPoint
+		ci.confirmBatch(seq)
+		return
 	}
 }
 
-// statsCollector waits for data arriving back on resultsChan and
-// errorsChan, aggregating results and panicking if an error occurs
+// statsCollector waits for data arriving back on resultsChan, aggregating
+// results until the channel is closed once the worker pool has drained.
 func (ci *CloudantImport) statsCollector() {
 	defer ci.wgCollector.Done()
-	for {
-		select {
-		// <- returns the value of the channel and boolean ok,
-		// that indicates whether the channel is open or not.
-		// If ok == false, we can return - nothing more to do
-		case r, ok := <-ci.resultsChan:
-			if !ok {
-				return
-			}
-			ci.stats.Save(&r)
-		case err, ok := <-ci.errorsChan:
-			if !ok {
-				return
-			}
-			panic(fmt.Sprintf("ERROR: %v", err))
-		}
+	for r := range ci.resultsChan {
+		ci.stats.Save(&r)
 	}
 }
 
@@ -139,10 +386,47 @@ func (ci *CloudantImport) checkTargetDatabase() error {
 	return err
 }
 
-// Run executes a CloudantImport job, reading lines of data from stdin,
-// parsing them as JSON and then turning the resultant map into a
-// Cloudant document suitable for the SDKs. Up to bufferSize documents
-// are bufferred in memory and written to Cloudant in bulk.
+// checkpoint persists point - the resume point of the latest batch
+// confirmed written (or otherwise resolved) in an unbroken sequence from
+// the start of the import - and a fresh stats snapshot, to the
+// --checkpoint file, if one was configured. It is only ever called from
+// confirmBatch while checkpointMu is held, so the persisted Offset/DocCount
+// can never run ahead of a batch whose outcome isn't yet known: on a crash,
+// the worst case is redoing every batch dispatched after the last one
+// confirmed in sequence - dispatch doesn't wait for a concurrency slot, so
+// that can be more than "concurrency" batches - never skipping one that was
+// never actually written.
+func (ci *CloudantImport) checkpoint(point resumePoint) {
+	if ci.appConfig.CheckpointPath == "" {
+		return
+	}
+	state := checkpointState{
+		Offset:   point.Offset,
+		DocCount: point.DocCount,
+		Stats:    ci.stats.snapshot(),
+	}
+	if err := saveCheckpoint(ci.appConfig.CheckpointPath, state); err != nil {
+		fmt.Println("WARNING: failed to save checkpoint:", err)
+	}
+}
+
+// Run executes a CloudantImport job, reading documents from the configured
+// input (stdin by default, or --input, in the format named by --format),
+// passing each through the --transform hook (if any) and --id-field/
+// --id-strategy, and turning the result into a Cloudant document suitable
+// for the SDKs. Up to the rate controller's current batch size are
+// buffered in memory and written to Cloudant in bulk, with the batch size
+// and the number of batches in flight adjusted automatically in response
+// to 429/503 feedback; documents rejected individually (e.g. on conflict)
+// are appended to --failed-output rather than failing their batch. If
+// --checkpoint is set, progress is saved as each batch's outcome is
+// confirmed (written, or dead-lettered) so the import can be resumed from
+// where it left off without skipping a batch still in flight. --progress
+// renders a live progress bar on stderr instead of the default per-batch
+// log line, whose format --log-format also controls (text or json). A
+// SIGINT/SIGTERM finishes any in-flight batches and prints a partial
+// summary rather than dying mid-write; an unrecoverable write error also
+// finishes any in-flight batches, then is returned instead of a summary.
 func (ci *CloudantImport) Run() error {
 
 	// check that the target database exists
@@ -151,77 +435,135 @@ func (ci *CloudantImport) Run() error {
 		return errors.New("database does not exist")
 	}
 
-	// Start worker pool
-	for i := 0; i < ci.appConfig.Concurrency; i++ {
-		ci.wgWorker.Add(1)
-		go ci.writeBufferWorker()
-	}
-
 	// spin up a goroutine to handle the results and errors
 	ci.wgCollector.Add(1)
 	go ci.statsCollector()
 
-	// loop until we run out of data
-	for {
-		// read a line
-		text, err := ci.reader.ReadString('\n')
-
-		// if this is the last line
-		if err != nil {
+	if ci.progress != nil {
+		ci.progress.Start()
+		defer ci.progress.Stop()
+	}
 
-			// flush the buffer
-			if ci.bufferLen > 0 {
-				// last write
-				ci.jobsChan <- ci.buffer[:ci.bufferLen]
-			}
+	// catch SIGINT/SIGTERM so an interrupted import drains its in-flight
+	// batches and prints a partial summary rather than dying mid-write.
+	// The read loop below only checks for the signal between documents, so
+	// it won't interrupt a read call that's already blocked waiting for
+	// more input (e.g. a stalled pipe) - it will, however, stop promptly
+	// once the next document is available.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	aborted := false
+
+	// if we're resuming from a checkpoint that couldn't be resumed by byte
+	// offset, skip the documents that were already imported in a previous run
+	for ci.skipDocs > 0 {
+		if _, err := ci.source.Next(); err != nil {
+			break
+		}
+		ci.skipDocs--
+	}
 
-			// close the jobs channel - we're finished
-			close(ci.jobsChan)
+	// loop until we run out of data or are interrupted. A Source may return
+	// a final document alongside a non-nil error (e.g. ndjson input with no
+	// trailing newline), so the document is buffered before the error ends
+	// the loop. The final, possibly partial, batch is flushed once after
+	// the loop regardless of which of those two ways it ended.
+	for {
+		select {
+		case <-sigChan:
+			aborted = true
+			fmt.Fprintln(os.Stderr, "\nreceived interrupt, finishing in-flight batches...")
+		case <-ci.ctx.Done():
+			aborted = true
+			fmt.Fprintln(os.Stderr, "\nwrite failed, finishing in-flight batches...")
+		default:
+		}
+		if aborted {
 			break
 		}
 
-		// strip the line break
-		text = strings.TrimSuffix(text, "\n")
-		text = strings.TrimSuffix(text, "\r")
+		dataMap, err := ci.source.Next()
+
+		// track the resume point by what the source has actually parsed
+		// and handed back, not by how far the reader beneath it has
+		// read ahead - see byteCounter
+		if ci.byteOffsetResume {
+			if bc, ok := ci.source.(byteCounter); ok {
+				ci.bytesRead = ci.byteOffsetBase + bc.BytesRead()
+			}
+		}
 
-		// if we have more than a blank line
-		if len(text) > 0 {
-			// parse the document and turn it into a format suitable for the SDKs
-			var dataMap map[string]interface{}
-			err := json.Unmarshal([]byte(text), &dataMap)
-			if err != nil {
-				// if it doesn't parse as JSON, skip to the next line
-				continue
+		if dataMap != nil {
+			// track how far into the input we are, so a checkpoint can
+			// record a resume point
+			ci.docCount++
+
+			// run the --transform hook, if any, to drop, rename or
+			// synthesize fields; a nil result drops the document
+			if ci.transform != nil {
+				transformed, transformErr := ci.transform(dataMap)
+				if transformErr != nil {
+					fmt.Println("WARNING: --transform failed, skipping document:", transformErr)
+					transformed = nil
+				}
+				dataMap = transformed
 			}
 
-			// generate a Cloudant doc
-			doc := cloudantv1.Document{}
-			doc.SetProperties(dataMap)
-
-			// add it to the buffer
-			ci.buffer[ci.bufferLen] = doc
-			ci.bufferLen++
-
-			// if the buffer is full
-			if ci.bufferLen == bufferSize {
-				// write to the jobs channel
-				// note to self - we have to clone the slice here because we will go on to
-				// reuse the underlying buffer which if we didn't clone, would  modify
-				// the data that the goroutine at the other end of the channel will see
-				clone := make([]cloudantv1.Document, ci.bufferLen)
-				copy(clone, ci.buffer[:ci.bufferLen])
-				ci.jobsChan <- clone
-				ci.bufferLen = 0
+			if dataMap != nil {
+				// promote or synthesize _id per --id-field/--id-strategy
+				ci.idAssigner.assign(dataMap, ci.docCount)
+
+				// generate a Cloudant doc
+				doc := cloudantv1.Document{}
+				doc.SetProperties(dataMap)
+
+				// add it to the buffer, keeping the pre-conversion map
+				// alongside it in case it needs dead-lettering later
+				ci.buffer[ci.bufferLen] = doc
+				ci.originals[ci.bufferLen] = dataMap
+				ci.bufferLen++
+
+				// if the buffer has reached (or, if the controller's
+				// target shrank mid-fill, overshot) the current batch
+				// size - an exact == here could be skipped entirely by a
+				// shrinking target and run ci.buffer past its capacity
+				if ci.bufferLen >= ci.controller.BatchSize() {
+					ci.dispatch(ci.buffer[:ci.bufferLen], ci.originals[:ci.bufferLen])
+					ci.bufferLen = 0
+				}
 			}
 		}
+
+		// if we've run out of data
+		if err != nil {
+			break
+		}
+	}
+
+	// flush the final, possibly partial, batch
+	if ci.bufferLen > 0 {
+		ci.dispatch(ci.buffer[:ci.bufferLen], ci.originals[:ci.bufferLen])
+		ci.bufferLen = 0
 	}
 
 	// wait for the in-flight requests to complete
 	ci.wgWorker.Wait()
 	close(ci.resultsChan)
-	close(ci.errorsChan)
 	ci.wgCollector.Wait()
 
+	if ci.deadLetter != nil {
+		if err := ci.deadLetter.Close(); err != nil {
+			fmt.Println("WARNING: failed to close --failed-output:", err)
+		}
+	}
+
+	// a worker hitting an unrecoverable error takes priority over a clean
+	// summary - the caller needs to know the import didn't fully succeed
+	if ci.fatalErr != nil {
+		return fmt.Errorf("write failed: %w", ci.fatalErr)
+	}
+
 	// generate final summary
 	ci.stats.Summary()
 
@@ -0,0 +1,195 @@
+package importer
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	growAfterCleanBatches = 10                     // consecutive clean batches required before growing
+	batchGrowStep         = 25                     // batch size increment on sustained success
+	backoffBase           = 500 * time.Millisecond // initial backoff on a 429/503
+	backoffMax            = 30 * time.Second       // backoff ceiling
+)
+
+// throttled reports whether a batch response status code indicates the
+// server wants the client to slow down.
+func throttled(statusCode int) bool {
+	return statusCode == 429 || statusCode == 503
+}
+
+// semaphore is a resizable counting semaphore used to cap the number of
+// HTTP write requests that are allowed to be in flight at once. Unlike a
+// plain buffered channel, its capacity can be grown or shrunk at runtime,
+// which is what lets the rate controller add or remove workers from the
+// pool while it's running.
+type semaphore struct {
+	mu     sync.Mutex
+	tokens chan struct{}
+	cur    int
+}
+
+// newSemaphore creates a semaphore that initially allows "initial"
+// concurrent holders, and can be grown up to "max".
+func newSemaphore(initial, max int) *semaphore {
+	s := &semaphore{tokens: make(chan struct{}, max)}
+	for i := 0; i < initial; i++ {
+		s.tokens <- struct{}{}
+	}
+	s.cur = initial
+	return s
+}
+
+// acquire blocks until a slot is available.
+func (s *semaphore) acquire() {
+	<-s.tokens
+}
+
+// release returns a slot to the pool.
+func (s *semaphore) release() {
+	s.tokens <- struct{}{}
+}
+
+// grow adds one more slot to the pool, up to its capacity.
+func (s *semaphore) grow() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur < cap(s.tokens) {
+		s.tokens <- struct{}{}
+		s.cur++
+	}
+}
+
+// shrinkTo removes slots from the pool until it allows at most "target"
+// concurrent holders. It blocks until enough in-flight holders have
+// released their slot, so it should be called from a goroutine that has
+// just released its own slot rather than one still holding it.
+func (s *semaphore) shrinkTo(target int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.cur > target {
+		<-s.tokens
+		s.cur--
+	}
+}
+
+// current returns the number of concurrent holders currently allowed.
+func (s *semaphore) current() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+// rateController implements an additive-increase/multiplicative-decrease
+// policy over the worker concurrency and batch size: a 429/503 response
+// halves both (down to their configured floors) and schedules an
+// exponentially growing, jittered backoff, while a run of clean batches
+// grows both back up (towards their configured ceilings) one step at a
+// time. This mirrors the feedback loop used by other throughput-sensitive
+// Go clients talking to rate-limited HTTP APIs.
+type rateController struct {
+	mu             sync.Mutex
+	sem            *semaphore
+	concurrency    int
+	minConcurrency int
+	maxConcurrency int
+	batchSize      int
+	minBatchSize   int
+	maxBatchSize   int
+	consecutiveOK  int
+	backoff        time.Duration
+}
+
+// newRateController creates a rateController seeded from the CLI-configured
+// starting concurrency and ceiling/floor batch sizes. The batch size starts
+// at its ceiling so behaviour is unchanged from a fixed-size import until
+// the controller actually observes throttling.
+func newRateController(appConfig *AppConfig) *rateController {
+	return &rateController{
+		sem:            newSemaphore(appConfig.Concurrency, appConfig.MaxConcurrency),
+		concurrency:    appConfig.Concurrency,
+		minConcurrency: 1,
+		maxConcurrency: appConfig.MaxConcurrency,
+		batchSize:      appConfig.MaxBatchSize,
+		minBatchSize:   appConfig.MinBatchSize,
+		maxBatchSize:   appConfig.MaxBatchSize,
+	}
+}
+
+// Concurrency returns the number of in-flight write requests currently
+// allowed.
+func (c *rateController) Concurrency() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.concurrency
+}
+
+// BatchSize returns the batch size that new jobs should be cut to.
+func (c *rateController) BatchSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.batchSize
+}
+
+// onResult folds the outcome of a single batch write into the controller
+// and returns a backoff duration the caller should sleep for before
+// sending its next batch - zero unless the response was throttled.
+func (c *rateController) onResult(statusCode int) time.Duration {
+	c.mu.Lock()
+
+	if throttled(statusCode) {
+		c.consecutiveOK = 0
+
+		// -1 means no shrink is needed; a concrete target is shrunk to
+		// below, after mu is released
+		shrinkTarget := -1
+		if c.concurrency > c.minConcurrency {
+			c.concurrency = c.minConcurrency + (c.concurrency-c.minConcurrency)/2
+			shrinkTarget = c.concurrency
+		}
+		if c.batchSize > c.minBatchSize {
+			c.batchSize = c.minBatchSize + (c.batchSize-c.minBatchSize)/2
+		}
+
+		if c.backoff == 0 {
+			c.backoff = backoffBase
+		} else if c.backoff < backoffMax {
+			c.backoff *= 2
+			if c.backoff > backoffMax {
+				c.backoff = backoffMax
+			}
+		}
+		// full jitter: sleep somewhere between 0 and the computed backoff
+		backoff := time.Duration(rand.Int63n(int64(c.backoff)))
+		c.mu.Unlock()
+
+		// shrinkTo blocks until enough in-flight workers have released
+		// their slot, and those workers need to take mu themselves (via
+		// their own onResult call) before they can return and release -
+		// so it must run with mu already released, or a burst of workers
+		// all hitting 429 at once deadlocks the whole pool against itself.
+		if shrinkTarget >= 0 {
+			c.sem.shrinkTo(shrinkTarget)
+		}
+		return backoff
+	}
+
+	c.backoff = 0
+	c.consecutiveOK++
+	if c.consecutiveOK >= growAfterCleanBatches {
+		c.consecutiveOK = 0
+		if c.concurrency < c.maxConcurrency {
+			c.concurrency++
+			c.sem.grow()
+		}
+		if c.batchSize < c.maxBatchSize {
+			c.batchSize += batchGrowStep
+			if c.batchSize > c.maxBatchSize {
+				c.batchSize = c.maxBatchSize
+			}
+		}
+	}
+	c.mu.Unlock()
+	return 0
+}
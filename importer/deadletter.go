@@ -0,0 +1,61 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// deadLetterRecord is a single --failed-output NDJSON line: the original
+// document alongside the reason Cloudant rejected it, e.g. "conflict".
+type deadLetterRecord struct {
+	Document map[string]interface{} `json:"document"`
+	Error    string                 `json:"error"`
+}
+
+// deadLetterWriter appends documents to --failed-output as NDJSON - those
+// that come back from a bulk write with a per-document error, and every
+// document of a batch still answered with a 429 or 5xx status once its
+// retries were exhausted - so users can inspect
+// and re-import just the failures rather than the whole input.
+type deadLetterWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newDeadLetterWriter opens path for appending, creating it if it doesn't
+// already exist. An empty path disables the dead-letter queue, returning a
+// nil writer and nil error.
+func newDeadLetterWriter(path string) (*deadLetterWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterWriter{file: file}, nil
+}
+
+// Write appends a single dead-lettered document. It's safe to call
+// concurrently from multiple writeBufferWorker goroutines.
+func (d *deadLetterWriter) Write(document map[string]interface{}, reason string) {
+	line, err := json.Marshal(deadLetterRecord{Document: document, Error: reason})
+	if err != nil {
+		fmt.Println("WARNING: failed to marshal dead-letter record:", err)
+		return
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.file.Write(line); err != nil {
+		fmt.Println("WARNING: failed to write dead-letter record:", err)
+	}
+}
+
+// Close closes the underlying --failed-output file.
+func (d *deadLetterWriter) Close() error {
+	return d.file.Close()
+}
@@ -1,6 +1,8 @@
 package importer
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 )
 
@@ -10,19 +12,70 @@ type LogLine struct {
 	LatencyMilliseconds int `json:"latency"`
 	DocsSuccess         int `json:"docsSuccess"`
 	DocsFailed          int `json:"docsFailed"`
+	Concurrency         int `json:"concurrency"` // the adaptive controller's concurrency when this batch was sent
+	BatchSize           int `json:"batchSize"`   // the adaptive controller's batch size when this batch was sent
 }
 
-func NewLogLine(statusCode int, latency int, success int, failed int) *LogLine {
+func NewLogLine(statusCode int, latency int, success int, failed int, concurrency int, batchSize int) *LogLine {
 	ll := LogLine{
 		StatusCode:          statusCode,
 		LatencyMilliseconds: latency,
 		DocsSuccess:         success,
 		DocsFailed:          failed,
+		Concurrency:         concurrency,
+		BatchSize:           batchSize,
 	}
 	return &ll
 }
 
-// Output writes a single log line to stdout
-func (ll *LogLine) Output() {
-	log.Println(ll.StatusCode, ll.LatencyMilliseconds, ll.DocsSuccess, ll.DocsFailed)
+// Reporter emits a LogLine somewhere - stdout as plain text, stdout as a
+// JSON record for a log pipeline, or nowhere at all while a --progress bar
+// owns the terminal. Stats.Save calls a Reporter once per batch instead of
+// writing output itself, so --log-format can be varied independently of
+// how stats are collected.
+type Reporter interface {
+	Report(ll *LogLine)
+}
+
+// textReporter is cloudantimport's original one-line-per-batch output.
+type textReporter struct{}
+
+func (textReporter) Report(ll *LogLine) {
+	log.Println(ll.StatusCode, ll.LatencyMilliseconds, ll.DocsSuccess, ll.DocsFailed, ll.Concurrency, ll.BatchSize)
+}
+
+// jsonReporter emits each LogLine as a single-line JSON record, suitable
+// for ingestion by a log pipeline.
+type jsonReporter struct{}
+
+func (jsonReporter) Report(ll *LogLine) {
+	jsonStr, err := json.Marshal(ll)
+	if err != nil {
+		fmt.Println("WARNING: failed to marshal log line:", err)
+		return
+	}
+	fmt.Println(string(jsonStr))
+}
+
+// noopReporter discards LogLines. It's used with --progress, where the
+// progress bar is the only thing that should be writing to the terminal.
+type noopReporter struct{}
+
+func (noopReporter) Report(*LogLine) {}
+
+// newReporter builds the Reporter named by --log-format ("text" or
+// "json"), or, if progress is true, a noopReporter regardless of format
+// since the progress bar owns output in that mode.
+func newReporter(logFormat string, progress bool) (Reporter, error) {
+	if progress {
+		return noopReporter{}, nil
+	}
+	switch logFormat {
+	case "", "text":
+		return textReporter{}, nil
+	case "json":
+		return jsonReporter{}, nil
+	default:
+		return nil, fmt.Errorf("log-format must be text or json, got %q", logFormat)
+	}
 }
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// progressTickInterval is how often the --progress bar redraws.
+const progressTickInterval = 500 * time.Millisecond
+
+// progressReporter renders a live, single-line progress bar to stderr
+// while an import runs: documents/sec, ETA (if --total is known),
+// concurrency and error count. It's a minimal in-tree equivalent of
+// libraries like cheggaaa/pb, reading Stats' atomic counters on a ticker
+// so it never contends with the hot Save() path.
+type progressReporter struct {
+	stats      *Stats
+	controller *rateController
+	total      int64 // --total; 0 means unknown, so no ETA is shown
+	start      time.Time
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// newProgressReporter builds a progressReporter. Call Start to begin
+// rendering and Stop to tear it down cleanly.
+func newProgressReporter(stats *Stats, controller *rateController, total int64) *progressReporter {
+	return &progressReporter{
+		stats:      stats,
+		controller: controller,
+		total:      total,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start begins rendering the progress bar in a background goroutine.
+func (p *progressReporter) Start() {
+	p.start = time.Now()
+	go p.run()
+}
+
+func (p *progressReporter) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(progressTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.render()
+		case <-p.stop:
+			p.render()
+			fmt.Fprintln(os.Stderr)
+			return
+		}
+	}
+}
+
+// render redraws the progress line in place using a carriage return and an
+// ANSI "clear to end of line" so it doesn't leave stray characters behind
+// when the line shrinks (e.g. the ETA going from "1h2m0s" to "59m0s").
+func (p *progressReporter) render() {
+	docs := p.stats.DocsWrittenCount()
+	errs := p.stats.ErrorCount()
+	elapsed := time.Since(p.start).Seconds()
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(docs) / elapsed
+	}
+
+	eta := "?"
+	if p.total > 0 && rate > 0 {
+		remaining := p.total - docs
+		if remaining < 0 {
+			remaining = 0
+		}
+		eta = (time.Duration(float64(remaining)/rate) * time.Second).Round(time.Second).String()
+	}
+
+	fmt.Fprintf(os.Stderr, "\r\033[K%d docs  %.1f docs/sec  concurrency=%d  errors=%d  eta=%s",
+		docs, rate, p.controller.Concurrency(), errs, eta)
+}
+
+// Stop renders a final frame, moves past the progress line, and waits for
+// the render goroutine to exit.
+func (p *progressReporter) Stop() {
+	close(p.stop)
+	<-p.done
+}
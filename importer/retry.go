@@ -0,0 +1,49 @@
+package importer
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxBatchRetries is how many times writeBufferWorker will retry a
+	// batch that failed with a retryable error before giving up on it. A
+	// transport error such as a timeout then fails the whole import; a
+	// retryable HTTP status with no transport error dead-letters the batch
+	// to --failed-output or, if that isn't set, fails the whole import.
+	maxBatchRetries = 5
+
+	// retryBaseDelay and retryMaxDelay bound the exponential backoff
+	// between retries of a single batch.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// isRetryableStatus reports whether an HTTP status code returned for a
+// bulk write is worth retrying: 429 (rate limited) or any 5xx.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// isRetryableErr reports whether a transport-level error (as opposed to an
+// HTTP response) is worth retrying, e.g. a request that timed out.
+func isRetryableErr(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryDelay returns the exponential backoff, with jitter, to wait before
+// retrying a batch for the given attempt number (0-based). The jitter
+// spreads retries from concurrent workers out so they don't all land on
+// Cloudant again at the same instant.
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// gzipMagic is the two leading bytes of a gzip stream, used to auto-detect
+// compressed input regardless of the format it contains.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Source yields documents to be imported one at a time, abstracting over
+// the different formats cloudantimport can read input in. Next returns
+// io.EOF once the input is exhausted, so callers can range over it with
+// the usual Go read-loop idiom.
+type Source interface {
+	Next() (map[string]interface{}, error)
+}
+
+// newSource wraps r in a gzip reader if its leading bytes look like a gzip
+// stream, then builds the Source named by format ("ndjson", "csv" or
+// "json"). csvTypes configures field type coercion for the csv format and
+// is ignored by the others.
+func newSource(format string, r io.Reader, csvTypes string) (Source, error) {
+	// reuse r directly if the caller already built a bufio.Reader (as
+	// New() does), rather than adding a second, independent buffering
+	// layer on top of it
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	magic, err := br.Peek(len(gzipMagic))
+	if err == nil && magic[0] == gzipMagic[0] && magic[1] == gzipMagic[1] {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+
+	switch format {
+	case "", "ndjson":
+		return newNDJSONSource(br), nil
+	case "csv":
+		return newCSVSource(br, csvTypes)
+	case "json":
+		return newJSONArraySource(br)
+	default:
+		return nil, fmt.Errorf("unknown --format %q: expected ndjson, csv or json", format)
+	}
+}
+
+// ndjsonSource reads one JSON object per line, the format cloudantimport
+// has always supported.
+type ndjsonSource struct {
+	reader    *bufio.Reader
+	bytesRead int64 // bytes actually consumed by Next so far; see BytesRead
+}
+
+func newNDJSONSource(r *bufio.Reader) *ndjsonSource {
+	return &ndjsonSource{reader: r}
+}
+
+// BytesRead returns how many bytes of the input Next has consumed so far.
+// It's tracked here, one ReadString call at a time, rather than by
+// counting raw Read()s on the reader beneath it: bufio.Reader pulls a
+// whole internal buffer's worth of bytes (4096 by default) from its
+// source in one Read, which would make a byte-offset checkpoint race far
+// ahead of what's actually been parsed and handed to the caller.
+func (s *ndjsonSource) BytesRead() int64 {
+	return s.bytesRead
+}
+
+// Next returns the next parsed line. Blank lines and lines that don't parse
+// as a JSON object are silently skipped, matching cloudantimport's
+// long-standing behaviour of tolerating stray whitespace in its input.
+func (s *ndjsonSource) Next() (map[string]interface{}, error) {
+	for {
+		text, err := s.reader.ReadString('\n')
+		s.bytesRead += int64(len(text))
+		if err != nil && text == "" {
+			return nil, err
+		}
+
+		text = strings.TrimSuffix(text, "\n")
+		text = strings.TrimSuffix(text, "\r")
+		if text == "" {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var dataMap map[string]interface{}
+		if jsonErr := json.Unmarshal([]byte(text), &dataMap); jsonErr != nil {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return dataMap, err
+	}
+}
+
+// csvSource reads a CSV file with a header row, mapping each subsequent row
+// to a document keyed by column name. Columns named in typeOverrides are
+// coerced from string to the given type; every other column is left as a
+// string.
+type csvSource struct {
+	reader        *csv.Reader
+	header        []string
+	typeOverrides map[string]string
+}
+
+// newCSVSource reads the header row immediately so construction fails fast
+// on an empty or malformed file. csvTypes is a comma-separated list of
+// column:type pairs, e.g. "age:int,score:float,active:bool" - columns not
+// listed are imported as strings.
+func newCSVSource(r *bufio.Reader, csvTypes string) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+
+	overrides := map[string]string{}
+	if csvTypes != "" {
+		for _, pair := range strings.Split(csvTypes, ",") {
+			colType := strings.SplitN(pair, ":", 2)
+			if len(colType) != 2 {
+				return nil, fmt.Errorf("invalid --csv-types entry %q: expected col:type", pair)
+			}
+			overrides[colType[0]] = colType[1]
+		}
+	}
+
+	return &csvSource{reader: reader, header: header, typeOverrides: overrides}, nil
+}
+
+// Next reads the next CSV row and maps it onto the header, coercing any
+// columns named in --csv-types to their configured type. A row with a cell
+// that doesn't coerce to its configured type (e.g. an empty string for an
+// int column) is skipped with a warning rather than ending the import,
+// matching ndjson's tolerance of a malformed line.
+func (s *csvSource) Next() (map[string]interface{}, error) {
+	for {
+		row, err := s.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		dataMap := make(map[string]interface{}, len(s.header))
+		rowErr := error(nil)
+		for i, col := range s.header {
+			if i >= len(row) {
+				continue
+			}
+			value, err := coerceCSVValue(row[i], s.typeOverrides[col])
+			if err != nil {
+				rowErr = fmt.Errorf("column %q: %w", col, err)
+				break
+			}
+			dataMap[col] = value
+		}
+		if rowErr != nil {
+			fmt.Println("WARNING: skipping malformed CSV row:", rowErr)
+			continue
+		}
+		return dataMap, nil
+	}
+}
+
+// coerceCSVValue converts a raw CSV field to the requested type. An
+// unrecognised or empty typeName leaves the value as a string.
+func coerceCSVValue(value, typeName string) (interface{}, error) {
+	switch typeName {
+	case "int":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
+
+// jsonArraySource streams the elements of a top-level JSON array without
+// holding the whole array in memory, using json.Decoder's token API.
+type jsonArraySource struct {
+	decoder *json.Decoder
+}
+
+// newJSONArraySource consumes the opening '[' token immediately so
+// construction fails fast if the input isn't a JSON array.
+func newJSONArraySource(r *bufio.Reader) (*jsonArraySource, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("reading json array: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected input to start with a JSON array")
+	}
+	return &jsonArraySource{decoder: decoder}, nil
+}
+
+// Next decodes the next array element. It returns io.EOF once the closing
+// ']' is reached.
+func (s *jsonArraySource) Next() (map[string]interface{}, error) {
+	if !s.decoder.More() {
+		// consume the closing ']' so callers see a clean io.EOF
+		if _, err := s.decoder.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	var dataMap map[string]interface{}
+	if err := s.decoder.Decode(&dataMap); err != nil {
+		return nil, err
+	}
+	return dataMap, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/IBM/cloudant-go-sdk/cloudantv1"
 )
@@ -17,26 +18,49 @@ type Stats struct {
 	ErrorMessages  map[string]int `json:"errors"`
 	DocsWritten    int            `json:"docs"`
 	BatchesWritten int            `json:"batches"`
+
+	// docsWrittenAtomic and errorCount mirror DocsWritten and the total of
+	// ErrorMessages, kept as plain atomics so a --progress bar can sample
+	// them on every tick without contending with Save()'s mutex.
+	docsWrittenAtomic int64 `json:"-"`
+	errorCount        int64 `json:"-"`
+
+	reporter Reporter // where each batch's LogLine is sent; defaults to textReporter
 }
 
 // StatsDataPoint is the result of a single write API call
 type StatsDataPoint struct {
-	statusCode int
-	result     []cloudantv1.DocumentResult
-	latency    int
+	statusCode  int
+	result      []cloudantv1.DocumentResult
+	latency     int
+	concurrency int // the adaptive controller's concurrency at the time of this call
+	batchSize   int // the adaptive controller's batch size at the time of this call
 }
 
-// NewStats creates a new empty Stats struct
-func NewStats() *Stats {
+// NewStats creates a new empty Stats struct that reports each batch's
+// LogLine via reporter.
+func NewStats(reporter Reporter) *Stats {
 	stats := Stats{
 		StatusCodes:    make(map[int]int, 5),
 		ErrorMessages:  make(map[string]int, 5),
 		DocsWritten:    0,
 		BatchesWritten: 0,
+		reporter:       reporter,
 	}
 	return &stats
 }
 
+// DocsWrittenCount and ErrorCount return the running totals via the
+// atomic counters maintained alongside the mutex-protected fields, for a
+// --progress bar to sample without blocking on in-flight Save() calls.
+func (s *Stats) DocsWrittenCount() int64 {
+	return atomic.LoadInt64(&s.docsWrittenAtomic)
+}
+
+func (s *Stats) ErrorCount() int64 {
+	return atomic.LoadInt64(&s.errorCount)
+}
+
 // Save updates the Stats struct with the latest HTTP status code and error message
 // and how many documents were written. This method is thread-safe.
 func (s *Stats) Save(statsDataPoint *StatsDataPoint) {
@@ -58,9 +82,12 @@ func (s *Stats) Save(statsDataPoint *StatsDataPoint) {
 	s.BatchesWritten++
 	s.mu.Unlock()
 
-	// create and output a log line (outside the lock since it's just I/O)
-	ll := NewLogLine(statsDataPoint.statusCode, statsDataPoint.latency, successCount, failureCount)
-	ll.Output()
+	atomic.AddInt64(&s.docsWrittenAtomic, int64(len(statsDataPoint.result)))
+	atomic.AddInt64(&s.errorCount, int64(failureCount))
+
+	// report the log line (outside the lock since it's just I/O)
+	ll := NewLogLine(statsDataPoint.statusCode, statsDataPoint.latency, successCount, failureCount, statsDataPoint.concurrency, statsDataPoint.batchSize)
+	s.reporter.Report(ll)
 }
 
 // Summary turns the Stats struct into JSON and outputs it.
@@ -71,3 +98,56 @@ func (s *Stats) Summary() {
 	jsonStr, _ := json.Marshal(s)
 	fmt.Println(string(jsonStr))
 }
+
+// statsSnapshot is the plain-data (no mutex) copy of a Stats used when
+// persisting to, or restoring from, a checkpoint file.
+type statsSnapshot struct {
+	StatusCodes    map[int]int    `json:"statusCodes"`
+	ErrorMessages  map[string]int `json:"errors"`
+	DocsWritten    int            `json:"docs"`
+	BatchesWritten int            `json:"batches"`
+}
+
+// snapshot returns a copy of the current counts suitable for JSON
+// serialization. This method is thread-safe.
+func (s *Stats) snapshot() statsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := statsSnapshot{
+		StatusCodes:    make(map[int]int, len(s.StatusCodes)),
+		ErrorMessages:  make(map[string]int, len(s.ErrorMessages)),
+		DocsWritten:    s.DocsWritten,
+		BatchesWritten: s.BatchesWritten,
+	}
+	for k, v := range s.StatusCodes {
+		snap.StatusCodes[k] = v
+	}
+	for k, v := range s.ErrorMessages {
+		snap.ErrorMessages[k] = v
+	}
+	return snap
+}
+
+// merge folds the counts from a previously persisted snapshot into s, so
+// that resuming from a checkpoint carries forward the totals from earlier
+// runs rather than starting the summary from zero. This method is
+// thread-safe.
+func (s *Stats) merge(prev statsSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range prev.StatusCodes {
+		s.StatusCodes[k] += v
+	}
+	for k, v := range prev.ErrorMessages {
+		s.ErrorMessages[k] += v
+	}
+	s.DocsWritten += prev.DocsWritten
+	s.BatchesWritten += prev.BatchesWritten
+
+	errCount := 0
+	for _, v := range prev.ErrorMessages {
+		errCount += v
+	}
+	atomic.AddInt64(&s.docsWrittenAtomic, int64(prev.DocsWritten))
+	atomic.AddInt64(&s.errorCount, int64(errCount))
+}
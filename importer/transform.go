@@ -0,0 +1,45 @@
+package importer
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+)
+
+// TransformFunc drops, renames or synthesizes fields on a parsed document
+// before it's buffered. It returns the document to import, or a nil map to
+// drop the document entirely.
+type TransformFunc func(map[string]interface{}) (map[string]interface{}, error)
+
+// loadTransform loads the --transform hook named by path. A Go plugin
+// (.so) is loaded with the standard library's plugin package and must
+// export a symbol named Transform of type TransformFunc. JavaScript
+// transforms aren't implemented yet - there's no JS runtime in this
+// module's dependencies, so that case returns an error rather than
+// silently doing nothing. An empty path means no transform was configured.
+func loadTransform(path string) (TransformFunc, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	switch filepath.Ext(path) {
+	case ".so":
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading --transform plugin: %w", err)
+		}
+		sym, err := p.Lookup("Transform")
+		if err != nil {
+			return nil, fmt.Errorf("--transform plugin %s: %w", path, err)
+		}
+		fn, ok := sym.(func(map[string]interface{}) (map[string]interface{}, error))
+		if !ok {
+			return nil, fmt.Errorf("--transform plugin %s: Transform has the wrong signature, want func(map[string]interface{}) (map[string]interface{}, error)", path)
+		}
+		return fn, nil
+	case ".js":
+		return nil, fmt.Errorf("--transform: javascript hooks are not supported yet; compile a Go plugin (.so) exporting Transform(map[string]interface{}) (map[string]interface{}, error) instead")
+	default:
+		return nil, fmt.Errorf("--transform: unrecognised hook file %q, expected a .so Go plugin", path)
+	}
+}